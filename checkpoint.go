@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checkpointState is the on-disk record written to --checkpoint: the byte
+// offset (from the start of the file, including the header) of the last
+// fully-committed bulk, plus a fingerprint of the source csv so --resume
+// can refuse to continue against a file that has since changed.
+type checkpointState struct {
+	Offset     int64  `json:"offset"`
+	HeaderHash string `json:"header_hash"`
+	FileSize   int64  `json:"file_size"`
+}
+
+func hashHeader(line string) string {
+	sum := sha256.Sum256([]byte(line))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCheckpoint returns (nil, nil) if path does not exist yet.
+func loadCheckpoint(path string) (*checkpointState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveCheckpoint writes state atomically: a temp file in the same
+// directory, fsynced, then renamed over the real path.
+func saveCheckpoint(path string, state checkpointState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Checkpointer tracks the highest *contiguous* sequence number acked so far
+// (workers finish bulks out of order, but the checkpoint may only ever
+// advance to an offset whose every preceding bulk has actually committed)
+// and periodically fsyncs it to disk.
+type Checkpointer struct {
+	path     string
+	interval time.Duration
+	state    checkpointState
+
+	mu        sync.Mutex
+	pending   map[int64]int64 // seq -> end offset, for bulks that finished out of order
+	nextSeq   int64           // next seq we're waiting on to keep the offset contiguous
+	dirty     bool
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+}
+
+// NewCheckpointer builds a checkpointer that will resume acking at seq 1
+// from startOffset (the byte offset already covered by a prior run, or just
+// past the header on a fresh one).
+func NewCheckpointer(path string, interval time.Duration, headerHash string, fileSize, startOffset int64) *Checkpointer {
+	return &Checkpointer{
+		path:     path,
+		interval: interval,
+		state:    checkpointState{Offset: startOffset, HeaderHash: headerHash, FileSize: fileSize},
+		pending:  make(map[int64]int64),
+		nextSeq:  1,
+	}
+}
+
+// Start launches the periodic fsync goroutine.
+func (cp *Checkpointer) Start() {
+	cp.stopCh = make(chan struct{})
+	cp.stoppedCh = make(chan struct{})
+	go func() {
+		defer close(cp.stoppedCh)
+		ticker := time.NewTicker(cp.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cp.flush()
+			case <-cp.stopCh:
+				cp.flush()
+				return
+			}
+		}
+	}()
+}
+
+// Ack records that the bulk with the given sequence number finished, ending
+// at endOffset. The checkpoint's offset only advances once every earlier
+// sequence number has also been acked, so bulks are never reordered past
+// each other even though workers finish out of order. A bulk that
+// permanently failed is not acked by default (see WorkerPool.ackFailedCheckpoint),
+// so the offset correctly stalls there and --resume retries it, rather than
+// skipping past rows that were never inserted; --ignore-errors opts back
+// into acking failures to keep the offset moving.
+func (cp *Checkpointer) Ack(seq, endOffset int64) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.pending[seq] = endOffset
+	for {
+		offset, ok := cp.pending[cp.nextSeq]
+		if !ok {
+			break
+		}
+		cp.state.Offset = offset
+		delete(cp.pending, cp.nextSeq)
+		cp.nextSeq++
+		cp.dirty = true
+	}
+}
+
+func (cp *Checkpointer) flush() {
+	cp.mu.Lock()
+	if !cp.dirty {
+		cp.mu.Unlock()
+		return
+	}
+	state := cp.state
+	cp.dirty = false
+	cp.mu.Unlock()
+
+	if err := saveCheckpoint(cp.path, state); err != nil {
+		log.Printf("checkpoint: failed to write %s: %s\n", cp.path, err.Error())
+	}
+}
+
+// Stop flushes one last time and waits for the background goroutine to
+// exit, so the checkpoint on disk reflects every bulk acked before Stop was
+// called.
+func (cp *Checkpointer) Stop() {
+	if cp.stopCh == nil {
+		return
+	}
+	close(cp.stopCh)
+	<-cp.stoppedCh
+}
+
+// resolveCheckpointStart validates an existing checkpoint (if --resume was
+// given) against the current file's header and size, returning the byte
+// offset to seek to before reading data rows.
+func resolveCheckpointStart(path string, resume bool, headerHash string, fileSize, headerBytes int64) (int64, error) {
+	if !resume {
+		return headerBytes, nil
+	}
+
+	state, err := loadCheckpoint(path)
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, errors.New("--resume given but no checkpoint found at " + path)
+	}
+	if state.HeaderHash != headerHash || state.FileSize != fileSize {
+		return 0, errors.New("checkpoint at " + path + " does not match this csv file (header or size changed)")
+	}
+	return state.Offset, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect abstracts the bits of SQL generation that differ between target
+// databases: driver selection, placeholder syntax, identifier quoting, and
+// the "insert but don't fail on duplicates" idiom.
+type Dialect interface {
+	// Name is the value accepted by the --driver flag.
+	Name() string
+	// DriverName is the database/sql driver name passed to sql.Open.
+	DriverName() string
+	// Placeholder returns the bind placeholder for the i-th value (1-based).
+	Placeholder(i int) string
+	// QuoteIdent quotes a table or column identifier.
+	QuoteIdent(ident string) string
+	// InsertPrefix returns the "INSERT ... INTO table (" clause, including
+	// whichever duplicate-tolerant keyword the dialect uses.
+	InsertPrefix(table string) string
+	// InsertSuffix returns anything that must follow the VALUES (...) list,
+	// such as Postgres' "ON CONFLICT DO NOTHING".
+	InsertSuffix() string
+	// QuoteLiteral renders a CSV field as a SQL string literal, for dialects
+	// that need to emit a self-contained dump file rather than bind params.
+	QuoteLiteral(value string) string
+}
+
+var dialects = map[string]Dialect{
+	"mysql":      mysqlDialect{},
+	"postgres":   postgresDialect{},
+	"sqlite":     sqliteDialect{},
+	"clickhouse": clickhouseDialect{},
+}
+
+// DialectFor looks up a Dialect by the --driver flag value.
+func DialectFor(name string) (Dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown --driver %q (supported: mysql, postgres, sqlite, clickhouse)", name)
+	}
+	return d, nil
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return "mysql" }
+func (mysqlDialect) DriverName() string { return "mysql" }
+func (mysqlDialect) Placeholder(i int) string {
+	return "?"
+}
+func (mysqlDialect) QuoteIdent(ident string) string {
+	return "`" + ident + "`"
+}
+func (d mysqlDialect) InsertPrefix(table string) string {
+	return "INSERT IGNORE INTO " + d.QuoteIdent(table) + " ("
+}
+func (mysqlDialect) InsertSuffix() string { return "" }
+func (mysqlDialect) QuoteLiteral(value string) string {
+	return quoteLiteralBackslash(value)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string       { return "postgres" }
+func (postgresDialect) DriverName() string { return "postgres" }
+func (postgresDialect) Placeholder(i int) string {
+	return fmt.Sprintf("$%d", i)
+}
+func (postgresDialect) QuoteIdent(ident string) string {
+	return `"` + ident + `"`
+}
+func (d postgresDialect) InsertPrefix(table string) string {
+	return "INSERT INTO " + d.QuoteIdent(table) + " ("
+}
+func (postgresDialect) InsertSuffix() string { return " ON CONFLICT DO NOTHING" }
+func (postgresDialect) QuoteLiteral(value string) string {
+	return quoteLiteralDouble(value)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite3" }
+func (sqliteDialect) Placeholder(i int) string {
+	return "?"
+}
+func (sqliteDialect) QuoteIdent(ident string) string {
+	return `"` + ident + `"`
+}
+func (d sqliteDialect) InsertPrefix(table string) string {
+	return "INSERT OR IGNORE INTO " + d.QuoteIdent(table) + " ("
+}
+func (sqliteDialect) InsertSuffix() string { return "" }
+func (sqliteDialect) QuoteLiteral(value string) string {
+	return quoteLiteralDouble(value)
+}
+
+type clickhouseDialect struct{}
+
+func (clickhouseDialect) Name() string       { return "clickhouse" }
+func (clickhouseDialect) DriverName() string { return "clickhouse" }
+func (clickhouseDialect) Placeholder(i int) string {
+	return "?"
+}
+func (clickhouseDialect) QuoteIdent(ident string) string {
+	return "`" + ident + "`"
+}
+func (d clickhouseDialect) InsertPrefix(table string) string {
+	// ClickHouse has no INSERT IGNORE / ON CONFLICT; dedup is left to table
+	// engines (e.g. ReplacingMergeTree).
+	return "INSERT INTO " + d.QuoteIdent(table) + " ("
+}
+func (clickhouseDialect) InsertSuffix() string { return "" }
+func (clickhouseDialect) QuoteLiteral(value string) string {
+	return quoteLiteralBackslash(value)
+}
+
+// quoteLiteralBackslash renders a string literal for dialects (MySQL,
+// ClickHouse) that use backslash escaping inside single-quoted strings.
+func quoteLiteralBackslash(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
+
+// quoteLiteralDouble renders a string literal for dialects (Postgres,
+// SQLite) that escape a single quote by doubling it, with no backslash
+// escaping.
+func quoteLiteralDouble(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -4,11 +4,9 @@ import (
 	"database/sql"
 	"encoding/csv"
 	"errors"
-	"io"
 	"log"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -18,20 +16,39 @@ import (
 )
 
 type ImportCmd struct {
-	Table                 *string
-	File                  *string
-	Delim                 *string
-	Db                    *string
-	Concurrency           *int
-	Bulk                  *int
-	SquashConsecutiveDups *bool
-	SquashAllDupsPerBulk  *bool
-	IgnoreColumns         *string
-	IgnoreColumns_        []string
-	IgnoreColumnsMap_     map[int]bool
-	RemapColumns          *string
-	RemapColumns_         map[string]string
-	IgnoreErrors          *bool
+	Table                  *string
+	File                   *string
+	Delim                  *string
+	Db                     *string
+	Concurrency            *int
+	Bulk                   *int
+	SquashConsecutiveDups  *bool
+	SquashAllDupsPerBulk   *bool
+	IgnoreColumns          *string
+	IgnoreColumns_         []string
+	IgnoreColumnsMap_      map[int]bool
+	RemapColumns           *string
+	RemapColumns_          map[string]string
+	IgnoreErrors           *bool
+	Driver                 *string
+	Dialect_               Dialect
+	Output                 *string
+	OutputFormat           *string
+	OutputCompress         *string
+	OutputFilesize         *int64
+	OutputFilenameTemplate *string
+	MaxRetries             *int
+	RetryBackoff           *time.Duration
+	CreateTable            *bool
+	SampleRows             *int
+	ColumnTypes            *string
+	ColumnTypes_           map[string]string
+	PrimaryKey             *string
+	Index                  *[]string
+	Mode                   *string
+	Checkpoint             *string
+	Resume                 *bool
+	CheckpointInterval     *time.Duration
 }
 
 func (c *ImportCmd) Flags(fs *pflag.FlagSet) {
@@ -45,7 +62,24 @@ func (c *ImportCmd) Flags(fs *pflag.FlagSet) {
 	c.SquashAllDupsPerBulk = fs.Bool("squash-all-dups-per-bulk", false, "squash all dups per bulk")
 	c.IgnoreColumns = fs.String("ignore-columns", "", "ignore columns")
 	c.RemapColumns = fs.String("remap-columns", "", "remap columns: x=y,i=j")
-	c.IgnoreErrors = fs.Bool("ignore-errors", false, "ignore errors")
+	c.IgnoreErrors = fs.Bool("ignore-errors", false, "ack the checkpoint past a bulk that exhausts --max-retries instead of stalling --resume there (default: stall, since the bulk never actually inserted)")
+	c.Driver = fs.String("driver", "mysql", "target database driver: mysql, postgres, sqlite, clickhouse")
+	c.Output = fs.String("output", "", "write the dump to chunk files named after this path (e.g. dump.sql -> dump-000.sql) instead of a live db (enables dump mode)")
+	c.OutputFormat = fs.String("output-format", "sql", "dump format when --output is set: sql, csv-chunks, tsv")
+	c.OutputCompress = fs.String("output-compress", "none", "dump compression when --output is set: none, gzip, zstd")
+	c.OutputFilesize = fs.Int64("output-filesize", 0, "split dump into chunks of roughly this many bytes (0 = single file)")
+	c.OutputFilenameTemplate = fs.String("output-filename-template", "", "printf-style chunk filename template, e.g. dump-%03d.sql (default derived from --output)")
+	c.MaxRetries = fs.Int("max-retries", 3, "retries for a bulk that fails with a transient error (deadlock, lock wait timeout); a bulk whose connection is lost is not retried, it fails and the worker reconnects for the next bulk")
+	c.RetryBackoff = fs.Duration("retry-backoff", 200*time.Millisecond, "initial backoff between retries, doubled after each attempt")
+	c.CreateTable = fs.Bool("create-table", false, "sample the csv and issue a CREATE TABLE IF NOT EXISTS before importing")
+	c.SampleRows = fs.Int("sample-rows", 1000, "rows to sample for --create-table type inference")
+	c.ColumnTypes = fs.String("column-types", "", "override inferred types: col=BIGINT,other=DATE")
+	c.PrimaryKey = fs.String("primary-key", "", "comma-separated columns to declare as the PRIMARY KEY with --create-table")
+	c.Index = fs.StringArray("index", nil, "comma-separated columns to index with --create-table (repeatable)")
+	c.Mode = fs.String("mode", "insert", "import strategy: insert (batched INSERTs) or load-data (mysql LOAD DATA LOCAL INFILE fast path)")
+	c.Checkpoint = fs.String("checkpoint", "", "path to a checkpoint file, to safely --resume an interrupted import")
+	c.Resume = fs.Bool("resume", false, "resume from --checkpoint instead of starting at the beginning of --file")
+	c.CheckpointInterval = fs.Duration("checkpoint-interval", 5*time.Second, "how often to fsync the checkpoint file")
 }
 
 func (c *ImportCmd) ValidateFlags() error {
@@ -58,8 +92,8 @@ func (c *ImportCmd) ValidateFlags() error {
 		return errors.New("Please supply a --table")
 	}
 
-	if *c.Db == "" {
-		return errors.New("Please supply a --db (user:pass@host/db)")
+	if *c.Db == "" && *c.Output == "" {
+		return errors.New("Please supply a --db (user:pass@host/db) or --output")
 	}
 
 	if *c.Concurrency < 0 {
@@ -70,6 +104,56 @@ func (c *ImportCmd) ValidateFlags() error {
 		return errors.New("Please supply a valid --bulk (>0)")
 	}
 
+	if *c.MaxRetries < 0 {
+		return errors.New("Please supply a valid --max-retries (>=0)")
+	}
+
+	if *c.Output != "" {
+		if err := validateOutputFlags(*c.OutputFormat, *c.OutputCompress); err != nil {
+			return err
+		}
+	}
+
+	if *c.SampleRows < 1 {
+		return errors.New("Please supply a valid --sample-rows (>0)")
+	}
+
+	c.ColumnTypes_ = make(map[string]string)
+	if *c.ColumnTypes != "" {
+		for _, mapping := range strings.Split(*c.ColumnTypes, ",") {
+			xy := strings.SplitN(mapping, "=", 2)
+			if len(xy) < 2 {
+				return errors.New("Column Types - invalid -> syntax is: column_x=TYPE,column_a=TYPE,...")
+			}
+			c.ColumnTypes_[xy[0]] = xy[1]
+		}
+	}
+
+	dialect, err := DialectFor(*c.Driver)
+	if err != nil {
+		return err
+	}
+	c.Dialect_ = dialect
+
+	if *c.Mode != "insert" && *c.Mode != "load-data" {
+		return errors.New("Please supply a valid --mode (insert, load-data)")
+	}
+	if *c.Mode == "load-data" && *c.Driver != "mysql" {
+		return errors.New("--mode=load-data is only supported with --driver mysql")
+	}
+
+	if *c.Resume && *c.Checkpoint == "" {
+		return errors.New("--resume requires --checkpoint")
+	}
+	if *c.Checkpoint != "" {
+		if *c.Output != "" {
+			return errors.New("--checkpoint cannot be combined with --output")
+		}
+		if *c.Mode != "insert" {
+			return errors.New("--checkpoint is only supported with --mode insert")
+		}
+	}
+
 	c.IgnoreColumnsMap_ = make(map[int]bool)
 	if *c.IgnoreColumns != "" {
 		c.IgnoreColumns_ = strings.Split(*c.IgnoreColumns, ",")
@@ -102,11 +186,24 @@ func (c *ImportCmd) Execute(cmd *cobra.Command, args []string) {
 	reader := csv.NewReader(file)
 	reader.Comma = rune((*c.Delim)[0]) // set custom comma for reader (default: ',')
 
+	if *c.Output != "" {
+		c.executeDump(reader)
+		return
+	}
+
 	// --------------------------------------------------------------------------
 	// database connection setup
 	// --------------------------------------------------------------------------
 
-	db, err := sql.Open("mysql", *c.Db)
+	dsn := *c.Db
+	if *c.Mode == "load-data" {
+		dsn, err = dsnForLoadData(dsn)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	db, err := sql.Open(c.Dialect_.DriverName(), dsn)
 	if err != nil {
 		log.Fatal(err.Error())
 		return
@@ -118,171 +215,94 @@ func (c *ImportCmd) Execute(cmd *cobra.Command, args []string) {
 		log.Fatal(err.Error())
 		return
 	}
-	// set max idle connections
+	// set max idle/open connections: one per worker, held for the run
 	db.SetMaxIdleConns(*c.Concurrency)
+	db.SetMaxOpenConns(*c.Concurrency)
 	defer db.Close()
 
-	// --------------------------------------------------------------------------
-	// read rows and insert into database
-	// --------------------------------------------------------------------------
-
-	start := time.Now() // to measure execution time
-
-	callback := make(chan int)                   // callback channel for insert goroutines
-	connections := 0                             // number of concurrent connections
-	insertions := 0                              // counts how many insertions have finished
-	available := make(chan bool, *c.Concurrency) // buffered channel, holds number of available connections
-	for i := 0; i < *c.Concurrency; i++ {
-		available <- true
+	if *c.CreateTable {
+		c.runCreateTable(func(stmt string) error {
+			_, err := db.Exec(stmt)
+			return err
+		})
 	}
 
-	// start status logger
-	c.startLogger(&insertions, &connections)
-
-	// start connection controller
-	c.startConnectionController(&insertions, &connections, callback, available)
-
-	var wg sync.WaitGroup
-	id := 1
-	isFirstRow := true
-	firstRowColumns := []string{}
-
-	for {
-		records := [][]string{}
-		for i := 0; i < *c.Bulk; i++ {
-			record, err := reader.Read()
-			if err == io.EOF {
-				break
+	if *c.Mode == "load-data" {
+		start := time.Now()
+		if err := c.runLoadData(db); err != nil {
+			if !isLoadDataRejected(err) {
+				log.Fatal(err.Error())
 			}
-			records = append(records, record)
-		}
-
-		if err != nil && err != io.EOF {
-			log.Fatal(err.Error())
-		}
-
-		if len(records) == 0 {
-			break
-		}
-
-		if isFirstRow {
-
-			query := "" // query statement
-
-			// filter columns
-			columns := []string{}
-		ColumnLoop:
-			for _, v := range records[0] {
-				col := v
-				if *c.IgnoreColumns != "" {
-					for wk, w := range c.IgnoreColumns_ {
-						if v == w {
-							c.IgnoreColumnsMap_[wk] = true
-							continue ColumnLoop
-						}
-					}
-				}
-				if *c.RemapColumns != "" {
-					if w, ok := c.RemapColumns_[v]; ok {
-						col = w
-					}
-				}
-				columns = append(columns, col)
-			}
-
-			c.parseColumns(columns, &query)
-			isFirstRow = false
-			firstRowColumns = columns
-
-		}
-
-		if <-available { // wait for available database connection
-
-			connections += 1
-			id += 1
-			wg.Add(1)
-
-			bulkQuery, bulkItems := c.parseBulkColumns(firstRowColumns, records)
-			go c.insert(id, bulkQuery, db, callback, &connections, &wg, bulkItems)
+			log.Printf("LOAD DATA LOCAL INFILE rejected by server (%s), falling back to --mode=insert\n", err.Error())
+		} else {
+			log.Printf("Execution time: %s\n", time.Since(start))
+			return
 		}
 	}
 
-	wg.Wait()
-
-	elapsed := time.Since(start)
-	log.Printf("Status: %d insertions\n", insertions)
-	log.Printf("Execution time: %s\n", elapsed)
-}
-
-// inserts data into database
-func (c *ImportCmd) insert(id int, query string, db *sql.DB, callback chan<- int, conns *int, wg *sync.WaitGroup, args []interface{}) {
-
-	// make a new statement for every insert,
-	// this is quite inefficient, but since all inserts are running concurrently,
-	// it's still faster than using a single prepared statement and
-	// inserting the data sequentielly.
-	// we have to close the statement after the routine terminates,
-	// so that the connection to the database is released and can be reused
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(args...)
-	if err != nil {
-		log.Printf("ID: %d (%d conns), %s\n", id, *conns, err.Error())
-	}
+	// --------------------------------------------------------------------------
+	// read rows and insert into database via a fixed worker pool
+	// --------------------------------------------------------------------------
 
-	// finished inserting, send id over channel to signalize termination of routine
-	callback <- id
-	wg.Done()
+	c.runInserts(db, file, reader)
 }
 
-// controls termination of program and number of connections to database
-func (c *ImportCmd) startConnectionController(insertions, connections *int, callback <-chan int, available chan<- bool) {
+// print status update to console every second
+func (c *ImportCmd) startLogger(pool *WorkerPool) {
 
 	go func() {
+		t := time.Tick(time.Second)
 		for {
-
-			<-callback // returns id of terminated routine
-
-			*insertions += 1  // a routine terminated, increment counter
-			*connections -= 1 // and unregister its connection
-
-			available <- true // make new connection available
+			<-t
+			log.Printf("Status: %d insertions, %d failed bulks\n", pool.Insertions(), pool.Failures())
 		}
 	}()
 }
 
-// print status update to console every second
-func (c *ImportCmd) startLogger(insertions, connections *int) {
-
-	go func() {
-		c := time.Tick(time.Second)
-		for {
-			<-c
-			log.Printf("Status: %d insertions, %d database connections\n", *insertions, *connections)
+// resolveColumns applies --ignore-columns and --remap-columns to the CSV
+// header row, recording each ignored column's header index in
+// IgnoreColumnsMap_ (matching how callers look it up against a record) and
+// returning the final output column list.
+func (c *ImportCmd) resolveColumns(header []string) []string {
+
+	columns := []string{}
+ColumnLoop:
+	for i, v := range header {
+		col := v
+		if *c.IgnoreColumns != "" {
+			for _, w := range c.IgnoreColumns_ {
+				if v == w {
+					c.IgnoreColumnsMap_[i] = true
+					continue ColumnLoop
+				}
+			}
 		}
-	}()
+		if *c.RemapColumns != "" {
+			if w, ok := c.RemapColumns_[v]; ok {
+				col = w
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns
 }
 
 // parse csv columns, create query statement
 func (c *ImportCmd) parseColumns(columns []string, query *string) {
 
-	*query = "INSERT IGNORE INTO " + *c.Table + " ("
+	*query = c.Dialect_.InsertPrefix(*c.Table)
 	placeholder := "VALUES ("
-	for i, c := range columns {
+	for i, col := range columns {
 		if i == 0 {
-			*query += c
-			placeholder += "?"
+			*query += c.Dialect_.QuoteIdent(col)
+			placeholder += c.Dialect_.Placeholder(i + 1)
 		} else {
-			*query += ", " + c
-			placeholder += ", ?"
+			*query += ", " + c.Dialect_.QuoteIdent(col)
+			placeholder += ", " + c.Dialect_.Placeholder(i+1)
 		}
 	}
 	placeholder += ")"
-	*query += ") " + placeholder
+	*query += ") " + placeholder + c.Dialect_.InsertSuffix()
 }
 
 // parse csv columns, create query statement
@@ -292,15 +312,16 @@ func (c *ImportCmd) parseBulkColumns(columns []string, bulks [][]string) (string
 	bulkItemMap := make(map[uint64]bool)
 	query := []string{}
 
-	query = append(query, "INSERT IGNORE INTO "+*c.Table+" (")
+	query = append(query, c.Dialect_.InsertPrefix(*c.Table))
 	for i, column := range columns {
-		query = append(query, column)
+		query = append(query, c.Dialect_.QuoteIdent(column))
 		if i != (len(columns) - 1) {
 			query = append(query, ",")
 		}
 	}
 	query = append(query, ") VALUES ")
 	lastEntryKey := uint64(0)
+	placeholderIndex := 1
 	for i, entry := range bulks {
 		// CRITICAL: this protected us from an invalid csv line.. but, with ignore columns, it won't work!
 		// if len(entry) != columnsLen {
@@ -338,7 +359,8 @@ func (c *ImportCmd) parseBulkColumns(columns []string, bulks [][]string) (string
 					continue
 				}
 			}
-			query = append(query, "?")
+			query = append(query, c.Dialect_.Placeholder(placeholderIndex))
+			placeholderIndex++
 			bulkItems = append(bulkItems, jv)
 			if j != (len(entry) - 1) {
 				query = append(query, ",")
@@ -347,7 +369,7 @@ func (c *ImportCmd) parseBulkColumns(columns []string, bulks [][]string) (string
 		query = append(query, ")")
 	}
 
-	bulkQuery := strings.Join(query, " ")
+	bulkQuery := strings.Join(query, " ") + c.Dialect_.InsertSuffix()
 
 	return bulkQuery, bulkItems
 }
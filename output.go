@@ -0,0 +1,432 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+// OutputSink writes generated INSERT statements (or CSV/TSV rows) to one or
+// more files on disk instead of executing them against a live database. It
+// rotates to a new file once the configured --output-filesize is exceeded.
+type OutputSink struct {
+	format     string // "sql", "csv-chunks", "tsv"
+	compress   string // "none", "gzip", "zstd"
+	template   string
+	maxBytes   int64
+	headerCols []string
+	chunkIndex int
+
+	file    *os.File
+	gzw     *gzip.Writer
+	zw      *zstd.Encoder
+	csvw    *csv.Writer
+	counter *byteCounter
+}
+
+// byteCounter wraps the chunk file itself, below any compressor, so
+// --output-filesize bounds the actual on-disk (post-compression) size of
+// each chunk rather than the uncompressed byte count fed into it.
+type byteCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	n, err := b.w.Write(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// NewOutputSink builds the sink described by ImportCmd's --output* flags.
+// It assumes ValidateFlags has already checked format/compress values.
+func NewOutputSink(c *ImportCmd) (*OutputSink, error) {
+
+	dir := filepath.Dir(*c.Output)
+	if dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	template := *c.OutputFilenameTemplate
+	if template == "" {
+		template = defaultFilenameTemplate(*c.Output, *c.OutputFormat, *c.OutputCompress)
+	}
+
+	return &OutputSink{
+		format:   *c.OutputFormat,
+		compress: *c.OutputCompress,
+		template: template,
+		maxBytes: *c.OutputFilesize,
+	}, nil
+}
+
+// defaultFilenameTemplate derives "base-%03d.ext[.gz|.zst]" from the --output
+// path when --output-filename-template is not given.
+func defaultFilenameTemplate(output, format, compress string) string {
+	ext := "sql"
+	switch format {
+	case "csv-chunks":
+		ext = "csv"
+	case "tsv":
+		ext = "tsv"
+	}
+
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	name := base + "-%03d." + ext
+	if compress == "gzip" {
+		name += ".gz"
+	} else if compress == "zstd" {
+		name += ".zst"
+	}
+	return name
+}
+
+// WriteSQL appends a rendered INSERT statement to the current chunk,
+// rotating to a new file first if doing so would exceed --output-filesize
+// (uncompressed output only; compressed output rotates reactively, see
+// ensureCapacity).
+func (s *OutputSink) WriteSQL(statement string) error {
+	if err := s.ensureCapacity(int64(len(statement))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.writer(), statement); err != nil {
+		return err
+	}
+	return s.flushCompressor()
+}
+
+// WriteRows appends CSV/TSV rows to the current chunk, writing the header
+// once per file, and rotates as needed.
+func (s *OutputSink) WriteRows(columns []string, records [][]string) error {
+	s.headerCols = columns
+
+	if err := s.ensureCapacity(0); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := s.csvw.Write(record); err != nil {
+			return err
+		}
+	}
+	s.csvw.Flush()
+	if err := s.csvw.Error(); err != nil {
+		return err
+	}
+	return s.flushCompressor()
+}
+
+// flushCompressor pushes the compressor's internal buffer out to the byte
+// counter below it, so s.counter.n reflects on-disk bytes written so far
+// rather than lagging behind whatever the compressor is still holding. A
+// no-op when --output-compress is "none", since writes already go straight
+// to the counter. Called once per WriteSQL/WriteRows call, this trades some
+// compression ratio (a sync-flush point per bulk instead of one per chunk)
+// for --output-filesize actually bounding the on-disk chunk size.
+func (s *OutputSink) flushCompressor() error {
+	switch s.compress {
+	case "gzip":
+		return s.gzw.Flush()
+	case "zstd":
+		return s.zw.Flush()
+	default:
+		return nil
+	}
+}
+
+// ensureCapacity rotates to a new chunk file if appending n more bytes would
+// put the current chunk over --output-filesize (0 means unlimited). n is
+// only meaningful uncompressed, where the counter sits directly on the file
+// and the exact post-write size is known ahead of time; once a compressor is
+// in between, the counter only reflects bytes flushed so far, so n is
+// ignored and this rotates reactively, once the chunk has already reached
+// the limit, the same as WriteRows does.
+func (s *OutputSink) ensureCapacity(n int64) error {
+	if s.file == nil {
+		return s.rotate()
+	}
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	if s.compress == "none" {
+		if s.counter.n+n > s.maxBytes {
+			return s.rotate()
+		}
+		return nil
+	}
+	if s.counter.n >= s.maxBytes {
+		return s.rotate()
+	}
+	return nil
+}
+
+// rotate closes the current chunk (if any) and opens the next one.
+func (s *OutputSink) rotate() error {
+	if err := s.closeCurrent(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf(s.template, s.chunkIndex)
+	s.chunkIndex++
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.counter = &byteCounter{w: f}
+
+	switch s.compress {
+	case "gzip":
+		s.gzw = gzip.NewWriter(s.counter)
+	case "zstd":
+		zw, err := zstd.NewWriter(s.counter)
+		if err != nil {
+			return err
+		}
+		s.zw = zw
+	}
+
+	if s.format != "sql" {
+		delim := ','
+		if s.format == "tsv" {
+			delim = '\t'
+		}
+		s.csvw = csv.NewWriter(s.writer())
+		s.csvw.Comma = delim
+		if len(s.headerCols) > 0 {
+			if err := s.csvw.Write(s.headerCols); err != nil {
+				return err
+			}
+			s.csvw.Flush()
+		}
+	}
+
+	return nil
+}
+
+// writer returns whatever callers should write through: the compressor if
+// one is active (which itself writes into the byte counter below it),
+// otherwise the byte counter directly.
+func (s *OutputSink) writer() io.Writer {
+	switch s.compress {
+	case "gzip":
+		return s.gzw
+	case "zstd":
+		return s.zw
+	default:
+		return s.counter
+	}
+}
+
+func (s *OutputSink) closeCurrent() error {
+	if s.file == nil {
+		return nil
+	}
+	if s.csvw != nil {
+		s.csvw.Flush()
+		if err := s.csvw.Error(); err != nil {
+			return err
+		}
+		s.csvw = nil
+	}
+	if s.gzw != nil {
+		if err := s.gzw.Close(); err != nil {
+			return err
+		}
+		s.gzw = nil
+	}
+	if s.zw != nil {
+		if err := s.zw.Close(); err != nil {
+			return err
+		}
+		s.zw = nil
+	}
+	f := s.file
+	s.file = nil
+	return f.Close()
+}
+
+// Close flushes and closes whichever chunk file is currently open.
+func (s *OutputSink) Close() error {
+	return s.closeCurrent()
+}
+
+// executeDump reads the whole CSV through reader and writes it to the
+// configured --output sink instead of a live database, honoring the same
+// --bulk, --ignore-columns, --remap-columns and dup-squashing flags as the
+// live-insert path.
+func (c *ImportCmd) executeDump(reader *csv.Reader) {
+
+	sink, err := NewOutputSink(c)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer sink.Close()
+
+	if *c.CreateTable && *c.OutputFormat == "sql" {
+		c.runCreateTable(sink.WriteSQL)
+	}
+
+	start := time.Now()
+	bulks := 0
+	isFirstRow := true
+	var firstRowColumns []string
+
+	for {
+		records := [][]string{}
+		var readErr error
+		for i := 0; i < *c.Bulk; i++ {
+			var record []string
+			record, readErr = reader.Read()
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				log.Fatal(readErr.Error())
+			}
+			records = append(records, record)
+		}
+
+		if len(records) == 0 {
+			break
+		}
+
+		if isFirstRow {
+			firstRowColumns = c.resolveColumns(records[0])
+			records = records[1:]
+			isFirstRow = false
+		}
+
+		records = c.squashRecords(records)
+		if len(records) == 0 {
+			continue
+		}
+
+		if *c.OutputFormat == "sql" {
+			statement := c.renderInsertSQL(firstRowColumns, records)
+			if err := sink.WriteSQL(statement); err != nil {
+				log.Fatal(err.Error())
+			}
+		} else {
+			if err := sink.WriteRows(firstRowColumns, c.filterRecords(records)); err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+
+		bulks++
+	}
+
+	elapsed := time.Since(start)
+	log.Printf("Status: %d bulks written\n", bulks)
+	log.Printf("Execution time: %s\n", elapsed)
+}
+
+// squashRecords drops duplicate rows within one bulk, honoring
+// --squash-all-dups-per-bulk and --squash-consecutive-dups; for the latter,
+// each row is compared with the last row kept.
+func (c *ImportCmd) squashRecords(records [][]string) [][]string {
+	if !*c.SquashAllDupsPerBulk && !*c.SquashConsecutiveDups {
+		return records
+	}
+
+	out := make([][]string, 0, len(records))
+	bulkItemMap := make(map[uint64]bool)
+	lastEntryKey := uint64(0)
+	for _, entry := range records {
+		entryKey := fnv1a.HashString64(strings.Join(entry, ""))
+		if *c.SquashAllDupsPerBulk {
+			if bulkItemMap[entryKey] {
+				continue
+			}
+			bulkItemMap[entryKey] = true
+		}
+		if *c.SquashConsecutiveDups {
+			if entryKey == lastEntryKey && lastEntryKey != 0 {
+				continue
+			}
+			lastEntryKey = entryKey
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// filterRecords drops ignored columns from each CSV row, matching the
+// filtering parseBulkColumns applies when building bind parameters.
+func (c *ImportCmd) filterRecords(records [][]string) [][]string {
+	if *c.IgnoreColumns == "" {
+		return records
+	}
+	out := make([][]string, 0, len(records))
+	for _, entry := range records {
+		row := make([]string, 0, len(entry))
+		for j, jv := range entry {
+			if _, ok := c.IgnoreColumnsMap_[j]; ok {
+				continue
+			}
+			row = append(row, jv)
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// renderInsertSQL builds a complete, literal INSERT statement (no bind
+// params) for dump mode, since there is no live connection to bind against.
+func (c *ImportCmd) renderInsertSQL(columns []string, records [][]string) string {
+	var sb strings.Builder
+
+	sb.WriteString(c.Dialect_.InsertPrefix(*c.Table))
+	for i, col := range columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(c.Dialect_.QuoteIdent(col))
+	}
+	sb.WriteString(") VALUES ")
+
+	filtered := c.filterRecords(records)
+	for i, entry := range filtered {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for j, jv := range entry {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(c.Dialect_.QuoteLiteral(jv))
+		}
+		sb.WriteString(")")
+	}
+	sb.WriteString(c.Dialect_.InsertSuffix())
+	sb.WriteString(";\n")
+
+	return sb.String()
+}
+
+var validOutputFormats = map[string]bool{"sql": true, "csv-chunks": true, "tsv": true}
+var validOutputCompress = map[string]bool{"none": true, "gzip": true, "zstd": true}
+
+func validateOutputFlags(format, compress string) error {
+	if !validOutputFormats[format] {
+		return errors.New("Please supply a valid --output-format (sql, csv-chunks, tsv)")
+	}
+	if !validOutputCompress[compress] {
+		return errors.New("Please supply a valid --output-compress (none, gzip, zstd)")
+	}
+	return nil
+}
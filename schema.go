@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is an inferred, dialect-neutral column type; dialectColumnType
+// maps it onto each target database's own type names.
+type ColumnType int
+
+const (
+	TypeBool ColumnType = iota
+	TypeInt
+	TypeBigInt
+	TypeDecimal
+	TypeDate
+	TypeDateTime
+	TypeVarchar
+	TypeText
+)
+
+// maxVarcharLen is the width above which we give up on VARCHAR(n) sizing
+// and fall back to TEXT.
+const maxVarcharLen = 1024
+
+var dateLayouts = []string{"2006-01-02"}
+var dateTimeLayouts = []string{"2006-01-02 15:04:05", time.RFC3339}
+
+// columnSchema is the inferred (or overridden) definition for one output
+// column, ready to render via dialectColumnType.
+type columnSchema struct {
+	name       string
+	typ        ColumnType
+	varcharLen int
+	nullable   bool
+}
+
+// inferSchema samples rows and widens conservatively per column: numeric
+// columns widen INT -> BIGINT -> DECIMAL on overflow, strings fall back to
+// VARCHAR(2x observed length, rounded up to a power of two, at least 16) or
+// TEXT when 2x the observed length is above maxVarcharLen, and a column is
+// nullable as soon as any sampled value is empty. overrides takes
+// precedence over inference, keyed by the (already remapped) column name.
+func inferSchema(columns []string, sample [][]string, overrides map[string]string) []columnSchema {
+
+	schemas := make([]columnSchema, len(columns))
+	for i, name := range columns {
+		schemas[i] = columnSchema{name: name, typ: TypeBool}
+	}
+
+	isBool := make([]bool, len(columns))
+	isInt := make([]bool, len(columns))
+	isBigInt := make([]bool, len(columns))
+	isDecimal := make([]bool, len(columns))
+	isDate := make([]bool, len(columns))
+	isDateTime := make([]bool, len(columns))
+	seenValue := make([]bool, len(columns))
+	for i := range columns {
+		isBool[i], isInt[i], isBigInt[i], isDecimal[i], isDate[i], isDateTime[i] = true, true, true, true, true, true
+	}
+
+	for _, row := range sample {
+		for i := range columns {
+			if i >= len(row) {
+				continue
+			}
+			v := row[i]
+			if v == "" {
+				schemas[i].nullable = true
+				continue
+			}
+			seenValue[i] = true
+
+			if len(v) > schemas[i].varcharLen {
+				schemas[i].varcharLen = len(v)
+			}
+
+			if isBool[i] && !isBoolValue(v) {
+				isBool[i] = false
+			}
+			if isInt[i] {
+				if _, err := strconv.ParseInt(v, 10, 32); err != nil {
+					isInt[i] = false
+				}
+			}
+			if isBigInt[i] {
+				if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+					isBigInt[i] = false
+				}
+			}
+			if isDecimal[i] {
+				if _, err := strconv.ParseFloat(v, 64); err != nil {
+					isDecimal[i] = false
+				}
+			}
+			if isDate[i] && !matchesLayout(v, dateLayouts) {
+				isDate[i] = false
+			}
+			if isDateTime[i] && !matchesLayout(v, dateTimeLayouts) {
+				isDateTime[i] = false
+			}
+		}
+	}
+
+	for i, name := range columns {
+		switch {
+		case !seenValue[i]:
+			schemas[i].typ, schemas[i].nullable = TypeText, true
+		case isBool[i]:
+			schemas[i].typ = TypeBool
+		case isInt[i]:
+			schemas[i].typ = TypeInt
+		case isBigInt[i]:
+			schemas[i].typ = TypeBigInt
+		case isDecimal[i]:
+			schemas[i].typ = TypeDecimal
+		case isDateTime[i]:
+			schemas[i].typ = TypeDateTime
+		case isDate[i]:
+			schemas[i].typ = TypeDate
+		case schemas[i].varcharLen*2 > maxVarcharLen:
+			schemas[i].typ = TypeText
+		default:
+			schemas[i].typ = TypeVarchar
+			schemas[i].varcharLen = nextPowerOfTwoLength(schemas[i].varcharLen * 2)
+		}
+
+		if override, ok := overrides[name]; ok {
+			schemas[i].typ, schemas[i].varcharLen = parseColumnTypeOverride(override)
+		}
+	}
+
+	return schemas
+}
+
+func isBoolValue(v string) bool {
+	switch strings.ToLower(v) {
+	case "0", "1", "true", "false":
+		return true
+	}
+	return false
+}
+
+func matchesLayout(v string, layouts []string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPowerOfTwoLength rounds n up to a "nice" VARCHAR size (16, 32, 64, ...).
+func nextPowerOfTwoLength(n int) int {
+	size := 16
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
+// parseColumnTypeOverride parses one --column-types entry's value, e.g.
+// "BIGINT" or "VARCHAR(128)".
+func parseColumnTypeOverride(value string) (ColumnType, int) {
+	name := value
+	length := 0
+	if idx := strings.Index(value, "("); idx != -1 && strings.HasSuffix(value, ")") {
+		name = value[:idx]
+		if n, err := strconv.Atoi(value[idx+1 : len(value)-1]); err == nil {
+			length = n
+		}
+	}
+	switch strings.ToUpper(name) {
+	case "BOOL", "BOOLEAN":
+		return TypeBool, 0
+	case "INT", "INTEGER":
+		return TypeInt, 0
+	case "BIGINT":
+		return TypeBigInt, 0
+	case "DECIMAL", "NUMERIC":
+		return TypeDecimal, 0
+	case "DATE":
+		return TypeDate, 0
+	case "DATETIME", "TIMESTAMP":
+		return TypeDateTime, 0
+	case "TEXT":
+		return TypeText, 0
+	case "VARCHAR":
+		if length == 0 {
+			length = 255
+		}
+		return TypeVarchar, length
+	default:
+		return TypeText, 0
+	}
+}
+
+// dialectColumnType renders a ColumnType as the given dialect's own type
+// name. ClickHouse wraps nullable columns in Nullable(...) rather than
+// using a NULL/NOT NULL constraint.
+func dialectColumnType(dialect Dialect, schema columnSchema) string {
+
+	var base string
+	switch dialect.Name() {
+	case "postgres":
+		switch schema.typ {
+		case TypeBool:
+			base = "BOOLEAN"
+		case TypeInt:
+			base = "INTEGER"
+		case TypeBigInt:
+			base = "BIGINT"
+		case TypeDecimal:
+			base = "NUMERIC(18,4)"
+		case TypeDate:
+			base = "DATE"
+		case TypeDateTime:
+			base = "TIMESTAMP"
+		case TypeText:
+			base = "TEXT"
+		default:
+			base = fmt.Sprintf("VARCHAR(%d)", schema.varcharLen)
+		}
+	case "sqlite":
+		switch schema.typ {
+		case TypeBool:
+			base = "BOOLEAN"
+		case TypeInt, TypeBigInt:
+			base = "INTEGER"
+		case TypeDecimal:
+			base = "NUMERIC"
+		case TypeDate:
+			base = "DATE"
+		case TypeDateTime:
+			base = "DATETIME"
+		case TypeText:
+			base = "TEXT"
+		default:
+			base = fmt.Sprintf("VARCHAR(%d)", schema.varcharLen)
+		}
+	case "clickhouse":
+		switch schema.typ {
+		case TypeBool:
+			base = "UInt8"
+		case TypeInt:
+			base = "Int32"
+		case TypeBigInt:
+			base = "Int64"
+		case TypeDecimal:
+			base = "Decimal(18,4)"
+		case TypeDate:
+			base = "Date"
+		case TypeDateTime:
+			base = "DateTime"
+		default:
+			base = "String"
+		}
+		if schema.nullable {
+			return "Nullable(" + base + ")"
+		}
+		return base
+	default: // mysql
+		switch schema.typ {
+		case TypeBool:
+			base = "TINYINT(1)"
+		case TypeInt:
+			base = "INT"
+		case TypeBigInt:
+			base = "BIGINT"
+		case TypeDecimal:
+			base = "DECIMAL(18,4)"
+		case TypeDate:
+			base = "DATE"
+		case TypeDateTime:
+			base = "DATETIME"
+		case TypeText:
+			base = "TEXT"
+		default:
+			base = fmt.Sprintf("VARCHAR(%d)", schema.varcharLen)
+		}
+	}
+
+	if schema.nullable {
+		return base + " NULL"
+	}
+	return base + " NOT NULL"
+}
+
+// createTableSQL renders a CREATE TABLE IF NOT EXISTS statement for the
+// given schema, honoring --primary-key and --index.
+func (c *ImportCmd) createTableSQL(schemas []columnSchema) string {
+
+	var sb strings.Builder
+	sb.WriteString("CREATE TABLE IF NOT EXISTS ")
+	sb.WriteString(c.Dialect_.QuoteIdent(*c.Table))
+	sb.WriteString(" (\n")
+
+	for i, schema := range schemas {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("  ")
+		sb.WriteString(c.Dialect_.QuoteIdent(schema.name))
+		sb.WriteString(" ")
+		sb.WriteString(dialectColumnType(c.Dialect_, schema))
+	}
+
+	if *c.PrimaryKey != "" {
+		sb.WriteString(",\n  PRIMARY KEY (")
+		sb.WriteString(c.quoteIdentList(strings.Split(*c.PrimaryKey, ",")))
+		sb.WriteString(")")
+	}
+
+	sb.WriteString("\n);\n")
+
+	for i, index := range *c.Index {
+		sb.WriteString(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);\n",
+			c.Dialect_.QuoteIdent(fmt.Sprintf("idx_%s_%d", *c.Table, i+1)),
+			c.Dialect_.QuoteIdent(*c.Table),
+			c.quoteIdentList(strings.Split(index, ","))))
+	}
+
+	return sb.String()
+}
+
+func (c *ImportCmd) quoteIdentList(idents []string) string {
+	quoted := make([]string, len(idents))
+	for i, ident := range idents {
+		quoted[i] = c.Dialect_.QuoteIdent(strings.TrimSpace(ident))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sampleForSchema reads the header and up to --sample-rows data rows from
+// their own pass over --file, independent of the main import reader, so
+// schema inference never disturbs the CSV cursor the importer uses.
+func (c *ImportCmd) sampleForSchema() (header []string, sample [][]string, err error) {
+
+	file, err := os.Open(*c.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = rune((*c.Delim)[0])
+
+	header, err = reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := 0; i < *c.SampleRows; i++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		sample = append(sample, record)
+	}
+
+	return header, sample, nil
+}
+
+// buildCreateTableStatement samples the CSV, infers (or overrides) a
+// schema, and renders the CREATE TABLE / CREATE INDEX statements for it.
+func (c *ImportCmd) buildCreateTableStatement() (string, error) {
+
+	header, sample, err := c.sampleForSchema()
+	if err != nil {
+		return "", err
+	}
+
+	columns := c.resolveColumns(header)
+	schemas := inferSchema(columns, sample, c.ColumnTypes_)
+
+	return c.createTableSQL(schemas), nil
+}
+
+// runCreateTable hands the inferred CREATE TABLE (and CREATE INDEX)
+// statements to exec (a live db's Exec, or the dump sink's WriteSQL).
+// Statements are separated by ";\n" and passed one at a time since most
+// database/sql drivers reject multi-statement Exec calls.
+func (c *ImportCmd) runCreateTable(exec func(string) error) {
+	statement, err := c.buildCreateTableStatement()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, stmt := range strings.Split(strings.TrimSpace(statement), ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if stmt == "" {
+			continue
+		}
+		if err := exec(stmt + ";\n"); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+}
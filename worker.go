@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// bulkJob is one unit of work handed from the CSV-reading producer to a
+// worker: a fully rendered bulk INSERT plus its bind parameters. seq and
+// endOffset are only populated when checkpointing is enabled.
+type bulkJob struct {
+	id        int
+	query     string
+	args      []interface{}
+	seq       int64
+	endOffset int64
+}
+
+// WorkerPool replaces the old unsynchronized goroutine-per-bulk approach
+// with a fixed set of long-lived workers, each holding its own *sql.Conn and
+// a small cache of prepared statements (one per distinct column-shape seen).
+// Jobs are handed out over a bounded channel, which is what provides
+// backpressure: the producer blocks on Submit once all workers are busy
+// instead of spawning unbounded goroutines.
+type WorkerPool struct {
+	db           *sql.DB
+	maxRetries   int
+	retryBackoff time.Duration
+	checkpointer *Checkpointer
+	ignoreErrors bool
+
+	jobs chan bulkJob
+	wg   sync.WaitGroup
+
+	insertions int64 // atomic
+	failures   int64 // atomic
+}
+
+// NewWorkerPool builds a pool of `concurrency` workers pulling from a
+// channel buffered to the same size, so at most one extra bulk per worker
+// can queue up before Submit blocks. checkpointer may be nil when
+// --checkpoint was not given. ignoreErrors is --ignore-errors: when false (the
+// default), a bulk that exhausts its retries is never acked, so the
+// checkpoint stalls there instead of letting --resume skip past rows that
+// were never inserted.
+func NewWorkerPool(db *sql.DB, concurrency, maxRetries int, retryBackoff time.Duration, checkpointer *Checkpointer, ignoreErrors bool) *WorkerPool {
+	return &WorkerPool{
+		db:           db,
+		maxRetries:   maxRetries,
+		retryBackoff: retryBackoff,
+		checkpointer: checkpointer,
+		ignoreErrors: ignoreErrors,
+		jobs:         make(chan bulkJob, concurrency),
+	}
+}
+
+// Start launches the worker goroutines. ctx is only used to acquire each
+// worker's *sql.Conn; cancelling it does not abort in-flight work, so that a
+// shutdown can drain whatever is already queued.
+func (p *WorkerPool) Start(ctx context.Context, concurrency int) error {
+	for i := 0; i < concurrency; i++ {
+		conn, err := p.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		p.wg.Add(1)
+		go p.run(conn)
+	}
+	return nil
+}
+
+// Submit hands a bulk to the pool. It blocks while all workers are busy,
+// which is the backpressure mechanism: the CSV reader can't outrun the
+// database by more than one buffered bulk per worker.
+func (p *WorkerPool) Submit(job bulkJob) {
+	p.jobs <- job
+}
+
+// CloseAndWait stops accepting new work, waits for every already-submitted
+// bulk (queued or in-flight) to finish, and closes each worker's connection.
+func (p *WorkerPool) CloseAndWait() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+func (p *WorkerPool) Insertions() int64 { return atomic.LoadInt64(&p.insertions) }
+func (p *WorkerPool) Failures() int64   { return atomic.LoadInt64(&p.failures) }
+
+// run is a single worker's loop: it owns conn and a per-worker prepared
+// statement cache for the lifetime of the pool, reconnecting both whenever
+// process reports the connection itself has died.
+func (p *WorkerPool) run(conn *sql.Conn) {
+	defer p.wg.Done()
+
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		conn.Close()
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	for job := range p.jobs {
+		if connDead := p.process(conn, stmts, job); connDead {
+			conn, stmts = p.reconnect(conn, stmts)
+		}
+	}
+}
+
+// reconnect drops a connection (and the prepared statements tied to it,
+// which die with it) and acquires a fresh one from the pool's *sql.DB,
+// blocking with exponential backoff until that succeeds. Unlike a *sql.DB, a
+// pinned *sql.Conn is never silently replaced by database/sql when its
+// underlying network connection is lost, so without this a worker would keep
+// retrying every subsequent bulk against a conn that can never succeed
+// again. Blocking here (rather than handing back a still-dead conn) means
+// process is never called again until the replacement is actually usable.
+func (p *WorkerPool) reconnect(conn *sql.Conn, stmts map[string]*sql.Stmt) (*sql.Conn, map[string]*sql.Stmt) {
+	conn.Close()
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+
+	backoff := p.retryBackoff
+	for {
+		newConn, err := p.db.Conn(context.Background())
+		if err == nil {
+			return newConn, make(map[string]*sql.Stmt)
+		}
+		log.Printf("worker: failed to reconnect, retrying in %s: %s\n", backoff, err.Error())
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// process executes one bulk, reusing a cached prepared statement for its
+// exact query text (bulks with the same row count share a statement),
+// retrying transient errors with
+// exponential backoff. It returns true when conn itself is no longer usable
+// and the caller should reconnect before handing it the next job.
+func (p *WorkerPool) process(conn *sql.Conn, stmts map[string]*sql.Stmt, job bulkJob) bool {
+
+	stmt, ok := stmts[job.query]
+	if !ok {
+		prepared, err := conn.PrepareContext(context.Background(), job.query)
+		if err != nil {
+			atomic.AddInt64(&p.failures, 1)
+			log.Printf("bulk %d: prepare failed: %s\n", job.id, err.Error())
+			p.ackFailedCheckpoint(job)
+			return isConnDeadErr(err)
+		}
+		stmts[job.query] = prepared
+		stmt = prepared
+	}
+
+	backoff := p.retryBackoff
+	var err error
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		_, err = stmt.ExecContext(context.Background(), job.args...)
+		if err == nil {
+			atomic.AddInt64(&p.insertions, 1)
+			p.ackCheckpoint(job)
+			return false
+		}
+		if isConnDeadErr(err) {
+			// retrying against the same dead conn/stmt can't succeed; stop
+			// so the caller reconnects before the next bulk.
+			break
+		}
+		if attempt == p.maxRetries || !isTransientErr(err) {
+			break
+		}
+		log.Printf("bulk %d: transient error, retrying in %s (attempt %d/%d): %s\n", job.id, backoff, attempt+1, p.maxRetries, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	atomic.AddInt64(&p.failures, 1)
+	log.Printf("bulk %d: %s\n", job.id, err.Error())
+	p.ackFailedCheckpoint(job)
+	return isConnDeadErr(err)
+}
+
+// ackCheckpoint records that job succeeded, advancing the checkpoint past it
+// once every earlier sequence number has also been acked.
+func (p *WorkerPool) ackCheckpoint(job bulkJob) {
+	if p.checkpointer != nil {
+		p.checkpointer.Ack(job.seq, job.endOffset)
+	}
+}
+
+// ackFailedCheckpoint is called in place of ackCheckpoint when a bulk
+// exhausted its retries. By default the bulk is left un-acked, so the
+// checkpoint's offset stalls at the last good sequence number and --resume
+// will retry it on the next run, rather than silently skipping rows that
+// were never inserted. --ignore-errors opts back into the old behavior of
+// acking it anyway, trading that data loss for forward progress.
+func (p *WorkerPool) ackFailedCheckpoint(job bulkJob) {
+	if p.checkpointer == nil {
+		return
+	}
+	if p.ignoreErrors {
+		p.checkpointer.Ack(job.seq, job.endOffset)
+		return
+	}
+	log.Printf("bulk %d: checkpoint progress stalled at this bulk; rerun with --resume to retry it, or pass --ignore-errors to skip past failures\n", job.id)
+}
+
+// isTransientErr reports whether err is worth retrying: a deadlock, a lock
+// wait timeout, or a lost/invalid connection.
+func isTransientErr(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1213, 1205: // ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+			return true
+		}
+		return false
+	}
+
+	return isConnDeadErr(err)
+}
+
+// isConnDeadErr reports whether err means the underlying *sql.Conn itself is
+// no longer usable, as opposed to a transient error that might clear on the
+// next attempt against the same connection. database/sql never re-dials a
+// pinned *sql.Conn on its own, so callers must treat this as a signal to
+// reconnect rather than just another retry.
+func isConnDeadErr(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, io.EOF)
+}